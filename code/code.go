@@ -5,6 +5,7 @@ const (
 	SessionUIDNotBind     int32 = 10 // session uid not bind
 	DiscoveryNotFoundNode int32 = 11 // discovery not fond node id
 	AppIsStop             int32 = 12 // application is stopped
+	SessionSendOverflow   int32 = 13 // session send queue exceeded high watermark past the grace period
 	RPCNetError           int32 = 20 // rpc net error
 	RPCUnmarshalError     int32 = 21 // rpc data unmarshal error
 	RPCMarshalError       int32 = 22 // rpc data marshal error
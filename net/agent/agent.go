@@ -2,6 +2,14 @@ package cherryAgent
 
 import (
 	"fmt"
+	"hash/fnv"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cherryCode "github.com/cherry-game/cherry/code"
 	"github.com/cherry-game/cherry/facade"
 	cherryLogger "github.com/cherry-game/cherry/logger"
 	"github.com/cherry-game/cherry/net/command"
@@ -10,31 +18,49 @@ import (
 	cherryProto "github.com/cherry-game/cherry/net/proto"
 	"github.com/cherry-game/cherry/net/session"
 	cherryProfile "github.com/cherry-game/cherry/profile"
-	"sync"
-	"sync/atomic"
-	"time"
 )
 
 const (
 	WriteBacklog = 64
+
+	// DefaultRPCTimeout is used when Options.RPCTimeout is not set
+	DefaultRPCTimeout = 5 * time.Second
 )
 
 type (
 	Options struct {
-		Heartbeat time.Duration                                // heartbeat(sec)
-		Commands  map[cherryPacket.Type]cherryCommand.ICommand // commands
+		Heartbeat      time.Duration                                // heartbeat(sec)
+		Commands       map[cherryPacket.Type]cherryCommand.ICommand // commands
+		RPCTimeout     time.Duration                                // cluster RPC call/CallWait timeout
+		RPCRouter      RPCRouteFunc                                 // route -> (nodeType, targetPath, method), defaults to DefaultRPCRoute
+		Codec          IPacketCodec                                 // packet framing/encoding, defaults to NewPomeloCodec(app)
+		SendQueueSize  int                                          // sendQueue capacity, defaults to DefaultSendQueueSize
+		HighWatermark  int                                          // queue length that starts the kick grace period, defaults to DefaultHighWatermark
+		LowWatermark   int                                          // queue length that resets the grace period, defaults to DefaultLowWatermark
+		WatermarkGrace time.Duration                                // how long the queue may stay above HighWatermark before the session is kicked
+		FlushInterval  time.Duration                                // batching tick, defaults to DefaultFlushInterval
+		Metrics        IWriterMetrics                               // optional send-path counters
+		ResumeStore    *ResumeStore                                 // shared resume-token store, nil disables session resume
+		ResumeTTL      time.Duration                                // how long a token survives after disconnect, defaults to DefaultResumeTTL
 	}
 
+	// RPCRouteFunc resolves a `route` (e.g. "game.room.join") into the node type to
+	// discover, the remote actor path to call and the remote method name.
+	RPCRouteFunc func(route string) (nodeType string, targetPath string, method string, err error)
+
 	Agent struct {
 		sync.RWMutex
 		*Options
 		cherryFacade.IApplication
-		Session *cherrySession.Session // session
-		conn    cherryFacade.INetConn  // low-level conn fd
-		chDie   chan bool              // wait for close
-		chSend  chan pendingMessage    // push message queue
-		chWrite chan []byte            // push bytes queue
-		lastAt  int64                  // last heartbeat unix time stamp
+		Session            *cherrySession.Session // session
+		conn               cherryFacade.INetConn  // low-level conn fd
+		chDie              chan bool              // wait for close
+		chClosed           chan struct{}          // closed exactly once in Close(), guards writeRaw against a send after write() has exited
+		queue              *sendQueue             // bounded ring buffer of pendingMessage, batched by write()
+		chWrite            chan []byte            // push pre-encoded bytes queue (e.g. Kick), never closed - see writeRaw
+		lastAt             int64                  // last heartbeat unix time stamp
+		highWatermarkSince int64                  // unix nano when queue length first crossed HighWatermark, 0 = not exceeded
+		resumeToken        string                 // resume token issued for this session, "" if ResumeStore is unset
 	}
 
 	pendingMessage struct {
@@ -51,12 +77,18 @@ func (p *pendingMessage) String() string {
 }
 
 func NewAgent(app cherryFacade.IApplication, conn cherryFacade.INetConn, opts *Options) *Agent {
+	queueSize := opts.SendQueueSize
+	if queueSize < 1 {
+		queueSize = DefaultSendQueueSize
+	}
+
 	agent := &Agent{
 		IApplication: app,
 		Options:      opts,
 		conn:         conn,
 		chDie:        make(chan bool),
-		chSend:       make(chan pendingMessage, WriteBacklog),
+		chClosed:     make(chan struct{}),
+		queue:        newSendQueue(queueSize),
 		chWrite:      make(chan []byte, WriteBacklog),
 	}
 
@@ -64,6 +96,10 @@ func NewAgent(app cherryFacade.IApplication, conn cherryFacade.INetConn, opts *O
 		agent.Heartbeat = 60 * time.Second
 	}
 
+	if agent.Codec == nil {
+		agent.Codec = NewPomeloCodec(app)
+	}
+
 	return agent
 }
 
@@ -75,22 +111,33 @@ func (a *Agent) Push(route string, val interface{}) {
 	a.Send(cherryMessage.Push, route, 0, val, false)
 }
 
+// writeRaw hands pkg to the single writer goroutine via chWrite. chWrite is
+// never closed (see write()'s defer), so this can't panic on a send to a
+// closed channel; chClosed is what write() closing looks like to producers
+// racing a Close(), and is safe to select on repeatedly from any goroutine.
+func (a *Agent) writeRaw(pkg []byte) {
+	select {
+	case a.chWrite <- pkg:
+	case <-a.chClosed:
+	}
+}
+
+// Kick encodes reason as a Kick packet and hands it to the single writer
+// goroutine via chWrite rather than writing a.conn directly, so it can't
+// interleave with flush()'s batched net.Buffers write running on write().
 func (a *Agent) Kick(reason interface{}) {
 	bytes, err := a.Marshal(reason)
 	if err != nil {
 		a.Session.Warnf("[Kick] marshal fail. [reason = %v] [error = %s].", reason, err)
 	}
 
-	pkg, err := a.PacketEncode(cherryPacket.Kick, bytes)
+	pkg, err := a.Codec.Encode(cherryPacket.Kick, bytes)
 	if err != nil {
 		a.Session.Warnf("[kick] packet encode error.[reason = %v] [error = %s].", reason, err)
 		return
 	}
 
-	_, err = a.conn.Write(pkg)
-	if err != nil {
-		cherryLogger.Warn(err)
-	}
+	a.writeRaw(pkg)
 
 	if cherryProfile.Debug() {
 		a.Session.Debugf("[Kick] [reason = %v]", reason)
@@ -106,12 +153,122 @@ func (a *Agent) Response(mid uint, v interface{}, isError ...bool) {
 	a.Send(cherryMessage.Response, "", mid, v, err)
 }
 
-func (a *Agent) RPC(route string, val interface{}, _ *cherryProto.Response) {
-	cherryLogger.Errorf("cluster no implement. [route = %s] [val = %v]", route, val)
+// RPC calls a remote handler by route and blocks until the response is filled
+// or the configured timeout elapses. The target node is resolved via
+// Discovery().ListByType(nodeType), mirroring rpcCenter.GetTargetPath.
+func (a *Agent) RPC(route string, val interface{}, rsp *cherryProto.Response) {
+	a.rpc(route, val, rsp, true)
+}
+
+// RPCPush is the fire-and-forget variant of RPC. It does not wait for the
+// remote handler to execute and never fills a response.
+func (a *Agent) RPCPush(route string, val interface{}) {
+	a.rpc(route, val, nil, false)
+}
+
+func (a *Agent) rpc(route string, val interface{}, rsp *cherryProto.Response, wait bool) {
+	routeFunc := a.RPCRouter
+	if routeFunc == nil {
+		routeFunc = DefaultRPCRoute
+	}
+
+	nodeType, targetPath, method, err := routeFunc(route)
+	if err != nil {
+		cherryLogger.Warnf("[RPC] route decode error. [route = %s] [error = %s]", route, err)
+		setRPCCode(rsp, cherryCode.RPCRouteDecodeError)
+		return
+	}
+
+	members := a.Discovery().ListByType(nodeType)
+	if len(members) < 1 {
+		cherryLogger.Warnf("[RPC] node not found. [route = %s] [nodeType = %s]", route, nodeType)
+		setRPCCode(rsp, cherryCode.DiscoveryNotFoundNode)
+		return
+	}
+
+	fullPath := pickRPCMember(members, a.Session.SID()+"|"+route).GetNodeId() + targetPath
+
+	if wait == false {
+		go func() {
+			if pushErr := a.ActorSystem().Call(a.Session.SID(), fullPath, method, val); pushErr != nil {
+				cherryLogger.Warnf("[RPC] push fail. [route = %s] [target = %s] [error = %s]", route, fullPath, pushErr)
+			}
+		}()
+		return
+	}
+
+	timeout := a.RPCTimeout
+	if timeout < 1 {
+		timeout = DefaultRPCTimeout
+	}
+
+	// CallWait fills a local response, never the caller-owned rsp directly: if
+	// we hit the timeout below, this goroutine is abandoned but keeps running,
+	// and writing into rsp after returning would race the caller reading it.
+	type callResult struct {
+		rsp *cherryProto.Response
+		err error
+	}
+
+	done := make(chan callResult, 1)
+	go func() {
+		localRsp := &cherryProto.Response{}
+		callErr := a.ActorSystem().CallWait(a.Session.SID(), fullPath, method, val, localRsp)
+		done <- callResult{rsp: localRsp, err: callErr}
+	}()
+
+	select {
+	case result := <-done:
+		if result.err != nil {
+			cherryLogger.Warnf("[RPC] remote execute error. [route = %s] [target = %s] [error = %s]", route, fullPath, result.err)
+			setRPCCode(rsp, cherryCode.RPCRemoteExecuteError)
+		} else if rsp != nil {
+			*rsp = *result.rsp
+		}
+	case <-time.After(timeout):
+		cherryLogger.Warnf("[RPC] remote execute timeout. [route = %s] [target = %s] [timeout = %s]", route, fullPath, timeout)
+		setRPCCode(rsp, cherryCode.RPCNetError)
+	}
+}
+
+// pickRPCMember spreads RPC calls across every node ListByType returned
+// instead of always hitting index 0, hashing key (session + route) so the
+// same session/route pair keeps landing on the same node.
+func pickRPCMember(members []cherryFacade.IMember, key string) cherryFacade.IMember {
+	if len(members) == 1 {
+		return members[0]
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+
+	return members[h.Sum32()%uint32(len(members))]
+}
+
+func setRPCCode(rsp *cherryProto.Response, code int32) {
+	if rsp != nil {
+		rsp.Code = code
+	}
+}
+
+// DefaultRPCRoute parses a route formatted as "nodeType.handler.method" (handler
+// may itself contain dots) into the discovery node type, the actor target path
+// (".handler", to be prefixed with the resolved node id) and the remote method.
+func DefaultRPCRoute(route string) (nodeType string, targetPath string, method string, err error) {
+	parts := strings.Split(route, ".")
+	if len(parts) < 3 {
+		return "", "", "", fmt.Errorf("invalid rpc route. route = %s", route)
+	}
+
+	nodeType = parts[0]
+	method = parts[len(parts)-1]
+	targetPath = "." + strings.Join(parts[1:len(parts)-1], ".")
+
+	return nodeType, targetPath, method, nil
 }
 
 func (a *Agent) SendRaw(bytes []byte) {
-	a.chWrite <- bytes
+	a.writeRaw(bytes)
 }
 
 func (a *Agent) RemoteAddr() string {
@@ -133,6 +290,14 @@ func (a *Agent) Close() {
 	a.Session.SetState(cherrySession.Closed)
 	a.Session.OnCloseProcess()
 
+	// signals writeRaw's producers (Kick, SendRaw, handleHandshake) to stop
+	// trying to push onto chWrite instead of blocking on it forever
+	close(a.chClosed)
+
+	if a.ResumeStore != nil && a.resumeToken != "" {
+		a.ResumeStore.Retain(a.resumeToken, a.ResumeTTL)
+	}
+
 	a.chDie <- true
 
 	if err := a.conn.Close(); err != nil {
@@ -146,13 +311,22 @@ func (a *Agent) Send(typ cherryMessage.Type, route string, mid uint, v interface
 		return
 	}
 
-	if len(a.chSend) >= WriteBacklog {
-		a.Session.Warnf("[send] session send buffer exceed")
+	pending := pendingMessage{typ: typ, mid: mid, route: route, payload: v, err: isError}
+
+	queued, full := a.queue.push(pending)
+	if full {
+		if a.Metrics != nil {
+			a.Metrics.OnDropped()
+		}
+		a.Session.Warnf("[send] session send queue exceed capacity[%d]", a.queue.capacity)
 		return
 	}
 
-	pending := pendingMessage{typ: typ, mid: mid, route: route, payload: v, err: isError}
-	a.chSend <- pending
+	if a.Metrics != nil {
+		a.Metrics.OnQueued(queued)
+	}
+
+	a.checkWatermark(queued)
 }
 
 func (a *Agent) Run() {
@@ -165,13 +339,21 @@ func (a *Agent) read() {
 		a.Close()
 	}()
 
+	// a codec that frames the wire itself (e.g. ProtobufFrameCodec) reads
+	// straight off the raw conn; conn.GetNextMessage() only understands
+	// pomelo's own header and would never deframe it correctly.
+	if streamCodec, ok := a.Codec.(IStreamCodec); ok {
+		a.readStream(streamCodec)
+		return
+	}
+
 	for {
 		msg, err := a.conn.GetNextMessage()
 		if err != nil {
 			return
 		}
 
-		packets, err := a.PacketDecode(msg)
+		packets, err := a.Codec.Decode(msg)
 		if err != nil {
 			a.Session.Warnf("packet decoder error. error[%s], msg[%s]", err, msg)
 			continue
@@ -187,17 +369,58 @@ func (a *Agent) read() {
 	}
 }
 
+func (a *Agent) readStream(codec IStreamCodec) {
+	// INetConn's concrete implementation wraps a real net.Conn under
+	// GetNextMessage(), so it satisfies io.Reader too; this assertion is on
+	// the concrete value, not the static INetConn interface. If a connector
+	// ever hands Agent an INetConn that only implements GetNextMessage(),
+	// IStreamCodec codecs (ProtobufFrameCodec) are unusable over it - this
+	// fails loudly via the log below rather than silently misbehaving, and
+	// the deferred Close() in read() still runs to tear the session down.
+	r, ok := a.conn.(io.Reader)
+	if !ok {
+		cherryLogger.Warnf("[read] conn[%T] does not implement io.Reader, cannot use stream codec.", a.conn)
+		return
+	}
+
+	for {
+		frame, err := codec.ReadFrame(r)
+		if err != nil {
+			return
+		}
+
+		packets, err := codec.Decode(frame)
+		if err != nil {
+			a.Session.Warnf("packet decoder error. error[%s]", err)
+			continue
+		}
+
+		for _, packet := range packets {
+			a.processPacket(packet)
+		}
+	}
+}
+
 func (a *Agent) write() {
+	flushInterval := a.FlushInterval
+	if flushInterval < 1 {
+		flushInterval = DefaultFlushInterval
+	}
+
 	ticker := time.NewTicker(a.Heartbeat)
+	flushTicker := time.NewTicker(flushInterval)
+
 	defer func() {
 		a.Session.Debugf("close session. [sid = %s]", a.Session.SID())
 
 		ticker.Stop()
+		flushTicker.Stop()
 		a.Close()
 
-		close(a.chSend)
-		close(a.chWrite)
-		//close(a.chDie)
+		// chWrite is deliberately never closed: Kick/SendRaw/handleHandshake can
+		// race this goroutine's exit from arbitrary goroutines, and a send on a
+		// closed channel panics. writeRaw selects on chClosed (closed by Close()
+		// above) instead, so a late send is dropped rather than panicking.
 	}()
 
 	for {
@@ -218,49 +441,38 @@ func (a *Agent) write() {
 				return
 			}
 
-		case data := <-a.chSend:
-			payload, err := a.Marshal(data.payload)
-			if err != nil {
-				a.Session.Debugf("message serializer error. data[%s]", data.String())
+		case <-flushTicker.C:
+			if !a.flush() {
 				return
 			}
-
-			// construct message and encode
-			m := &cherryMessage.Message{
-				Type:  data.typ,
-				ID:    data.mid,
-				Route: data.route,
-				Data:  payload,
-				Error: data.err,
-			}
-
-			// encode message
-			em, err := cherryMessage.Encode(m)
-			if err != nil {
-				cherryLogger.Warn(err)
-				break
-			}
-
-			// encode packet
-			p, err := a.PacketEncode(cherryPacket.Data, em)
-			if err != nil {
-				cherryLogger.Warn(err)
-				break
-			}
-			a.chWrite <- p
 		}
 	}
 }
 
 func (a *Agent) processPacket(packet cherryFacade.IPacket) {
-	cmd, found := a.Commands[packet.Type()]
-	if found == false {
-		a.Session.Debugf("packet[%s] type not found.", packet)
+	if a.Session == nil {
+		cherryLogger.Warnf("session is nil.")
 		return
 	}
 
-	if a.Session == nil {
-		cherryLogger.Warnf("session is nil.")
+	// resume is opt-in: only intercept the handshake when Options.ResumeStore
+	// is configured, otherwise fall through to the configured Handshake
+	// command unchanged so a plain pomelo client's handshake isn't touched.
+	if a.ResumeStore != nil {
+		switch packet.Type() {
+		case cherryPacket.Handshake:
+			a.handleHandshake(packet)
+			return
+		case cherryPacket.HandshakeAck:
+			// completes the 3-way handshake, nothing to answer
+			a.SetLastAt()
+			return
+		}
+	}
+
+	cmd, found := a.Commands[packet.Type()]
+	if found == false {
+		a.Session.Debugf("packet[%s] type not found.", packet)
 		return
 	}
 
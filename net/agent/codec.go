@@ -0,0 +1,186 @@
+package cherryAgent
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+
+	cherryFacade "github.com/cherry-game/cherry/facade"
+	cherryPacket "github.com/cherry-game/cherry/net/packet"
+)
+
+// IPacketCodec decodes raw bytes read off the wire into one or more packets, and
+// encodes an outgoing packet type + payload back into wire bytes. Agent reads
+// the codec from Options.Codec instead of calling a hard-wired packet format,
+// so clients speaking a different wire protocol (raw TCP bots, custom Unity
+// clients) can plug in their own framing without forking the agent.
+type IPacketCodec interface {
+	Decode(data []byte) ([]cherryFacade.IPacket, error)
+	Encode(typ cherryPacket.Type, data []byte) ([]byte, error)
+}
+
+// IStreamCodec is implemented by codecs that own message-boundary framing
+// themselves, such as ProtobufFrameCodec. conn.GetNextMessage() only
+// understands pomelo's own header, so a codec that needs different framing
+// can't be deframed by it; Agent.read detects IStreamCodec and reads frames
+// directly off the raw conn via ReadFrame instead of going through
+// GetNextMessage first.
+type IStreamCodec interface {
+	IPacketCodec
+	ReadFrame(r io.Reader) ([]byte, error)
+}
+
+// PomeloCodec is the default codec and keeps Agent's previous behaviour,
+// delegating to the pomelo-style packet encode/decode already implemented on
+// the application.
+type PomeloCodec struct {
+	app cherryFacade.IApplication
+}
+
+func NewPomeloCodec(app cherryFacade.IApplication) *PomeloCodec {
+	return &PomeloCodec{app: app}
+}
+
+func (c *PomeloCodec) Decode(data []byte) ([]cherryFacade.IPacket, error) {
+	return c.app.PacketDecode(data)
+}
+
+func (c *PomeloCodec) Encode(typ cherryPacket.Type, data []byte) ([]byte, error) {
+	return c.app.PacketEncode(typ, data)
+}
+
+// ProtobufFrameCodec frames each packet as [varint length][1 byte type][payload],
+// similar to the length-prefixed TCP packet protocol used by non-pomelo
+// clients that send raw protobuf payloads. It implements IStreamCodec: frame
+// boundaries are read directly off the conn (see ReadFrame), not derived from
+// pomelo's conn.GetNextMessage(), so a raw-TCP protobuf client is deframed
+// end-to-end by its own codec.
+type ProtobufFrameCodec struct{}
+
+func NewProtobufFrameCodec() *ProtobufFrameCodec {
+	return &ProtobufFrameCodec{}
+}
+
+// MaxFrameSize bounds a single ProtobufFrameCodec frame, mirroring the cap the
+// pomelo packet path already enforces on its own 3-byte length header. Without
+// it, a crafted varint length would force ReadFrame into an unbounded
+// make([]byte, length) allocation - an easy OOM DoS.
+const MaxFrameSize = 64 * 1024
+
+// ReadFrame reads one [varint length][1 byte type][payload] frame off r.
+func (c *ProtobufFrameCodec) ReadFrame(r io.Reader) ([]byte, error) {
+	length, err := binary.ReadUvarint(byteReader{r})
+	if err != nil {
+		return nil, err
+	}
+
+	if length < 1 {
+		return nil, fmt.Errorf("protobuf frame: empty frame")
+	}
+
+	if length > MaxFrameSize {
+		return nil, fmt.Errorf("protobuf frame: frame too large. length = %d, max = %d", length, MaxFrameSize)
+	}
+
+	body := make([]byte, length)
+	if _, err = io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
+
+// Decode interprets a single frame as returned by ReadFrame: [1 byte type][payload].
+func (c *ProtobufFrameCodec) Decode(data []byte) ([]cherryFacade.IPacket, error) {
+	if len(data) < 1 {
+		return nil, fmt.Errorf("protobuf frame: empty frame")
+	}
+
+	typ := cherryPacket.Type(data[0])
+	payload := append([]byte(nil), data[1:]...)
+
+	return []cherryFacade.IPacket{&protobufPacket{typ: typ, data: payload}}, nil
+}
+
+func (c *ProtobufFrameCodec) Encode(typ cherryPacket.Type, data []byte) ([]byte, error) {
+	body := make([]byte, 1+len(data))
+	body[0] = byte(typ)
+	copy(body[1:], data)
+
+	header := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(header, uint64(len(body)))
+
+	return append(header[:n], body...), nil
+}
+
+// byteReader adapts an io.Reader to io.ByteReader for binary.ReadUvarint,
+// reading one byte at a time so it never reads past the varint header.
+type byteReader struct {
+	r io.Reader
+}
+
+func (b byteReader) ReadByte() (byte, error) {
+	buf := [1]byte{}
+	if _, err := io.ReadFull(b.r, buf[:]); err != nil {
+		return 0, err
+	}
+	return buf[0], nil
+}
+
+// protobufPacket is the IPacket implementation produced by ProtobufFrameCodec.
+type protobufPacket struct {
+	typ  cherryPacket.Type
+	data []byte
+}
+
+func (p *protobufPacket) Type() cherryPacket.Type {
+	return p.typ
+}
+
+func (p *protobufPacket) Data() []byte {
+	return p.data
+}
+
+func (p *protobufPacket) String() string {
+	return fmt.Sprintf("type = %d, dataLen = %d", p.typ, len(p.data))
+}
+
+var (
+	codecRegistryMu sync.RWMutex
+	codecRegistry   = map[byte]IPacketCodec{}
+)
+
+// RegisterCodec associates a handshake byte with a codec. A connector accepting
+// new connections can peek at the first byte sent by the client and call
+// CodecByHandshakeByte to pick the matching wire format before handing the
+// connection to NewAgent.
+func RegisterCodec(handshakeByte byte, codec IPacketCodec) {
+	codecRegistryMu.Lock()
+	defer codecRegistryMu.Unlock()
+
+	codecRegistry[handshakeByte] = codec
+}
+
+// CodecByHandshakeByte looks up a codec previously registered with RegisterCodec.
+func CodecByHandshakeByte(handshakeByte byte) (IPacketCodec, bool) {
+	codecRegistryMu.RLock()
+	defer codecRegistryMu.RUnlock()
+
+	codec, found := codecRegistry[handshakeByte]
+	return codec, found
+}
+
+// NewAgentFromHandshakeByte is the registration hook a connector calls after
+// peeking the first byte of a new connection: it resolves the matching codec
+// via CodecByHandshakeByte and builds the Agent with it, falling back to
+// opts.Codec (or NewPomeloCodec) when no codec was registered for that byte.
+func NewAgentFromHandshakeByte(app cherryFacade.IApplication, conn cherryFacade.INetConn, opts *Options, handshakeByte byte) *Agent {
+	if codec, found := CodecByHandshakeByte(handshakeByte); found {
+		optsCopy := *opts
+		optsCopy.Codec = codec
+		opts = &optsCopy
+	}
+
+	return NewAgent(app, conn, opts)
+}
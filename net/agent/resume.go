@@ -0,0 +1,220 @@
+package cherryAgent
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	cherryFacade "github.com/cherry-game/cherry/facade"
+	cherryLogger "github.com/cherry-game/cherry/logger"
+	cherryPacket "github.com/cherry-game/cherry/net/packet"
+	cherrySession "github.com/cherry-game/cherry/net/session"
+)
+
+// DefaultResumeTTL is how long a resume token stays valid after its session
+// disconnects, before a reconnecting client is given up on and the session is
+// discarded for good.
+const DefaultResumeTTL = 2 * time.Minute
+
+// pomeloHandshakeOK is pomelo's own handshake success code, distinct from the
+// business-level cherryCode.* response codes (which happen to start at 0):
+// pomelo clients treat any non-200 handshake response as a failed handshake.
+const pomeloHandshakeOK int32 = 200
+
+type resumeEntry struct {
+	session  *cherrySession.Session
+	expireAt time.Time
+}
+
+// ResumeStore keeps resume tokens issued on first handshake so a reconnecting
+// client re-binds to its previous cherrySession.Session (UID, bound data)
+// instead of getting a fresh one. One store is shared by every Agent created
+// by a connector (set via Options.ResumeStore); it is process-local, a
+// clustered deployment would back it with a shared store keyed the same way.
+type ResumeStore struct {
+	mu      sync.Mutex
+	entries map[string]*resumeEntry
+}
+
+func NewResumeStore() *ResumeStore {
+	return &ResumeStore{
+		entries: make(map[string]*resumeEntry),
+	}
+}
+
+// Issue generates and stores a new resume token for session.
+func (s *ResumeStore) Issue(session *cherrySession.Session) string {
+	token := newResumeToken()
+
+	s.mu.Lock()
+	s.entries[token] = &resumeEntry{session: session}
+	s.mu.Unlock()
+
+	return token
+}
+
+// Retain starts the TTL countdown a reconnecting client has to come back
+// within after its session disconnects. Called from Agent.Close.
+func (s *ResumeStore) Retain(token string, ttl time.Duration) {
+	if token == "" {
+		return
+	}
+
+	if ttl < 1 {
+		ttl = DefaultResumeTTL
+	}
+
+	s.mu.Lock()
+	entry, found := s.entries[token]
+	if found {
+		entry.expireAt = time.Now().Add(ttl)
+	}
+	s.mu.Unlock()
+
+	if found {
+		time.AfterFunc(ttl, func() {
+			s.expire(token)
+		})
+	}
+}
+
+// Resume looks up and removes token, returning the session to rebind to if it
+// is still present and has not expired.
+func (s *ResumeStore) Resume(token string) (*cherrySession.Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, found := s.entries[token]
+	if !found {
+		return nil, false
+	}
+
+	delete(s.entries, token)
+
+	if !entry.expireAt.IsZero() && time.Now().After(entry.expireAt) {
+		return nil, false
+	}
+
+	return entry.session, true
+}
+
+func (s *ResumeStore) expire(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, found := s.entries[token]; found && time.Now().After(entry.expireAt) {
+		delete(s.entries, token)
+	}
+}
+
+func newResumeToken() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// IssueResumeToken issues (or returns the already-issued) resume token for
+// this agent's session, so handleHandshake can hand it back to the client in
+// the Handshake reply. Returns "" if Options.ResumeStore is not configured.
+func (a *Agent) IssueResumeToken() string {
+	if a.ResumeStore == nil {
+		return ""
+	}
+
+	if a.resumeToken == "" {
+		a.resumeToken = a.ResumeStore.Issue(a.Session)
+	}
+
+	return a.resumeToken
+}
+
+// BindResumeToken looks up a resume token presented by a reconnecting client
+// and, if still valid, rebinds this agent's Session to the previous one (UID,
+// bound data) instead of the freshly created one. Returns whether the rebind
+// happened.
+//
+// The restored session still has its network binding pointing at the old,
+// already-closed agent/conn - session.Rebind repoints it at this agent so
+// Session.Response/Push actually write to the live connection. The old agent
+// never touches the session again: it transitioned to Closed (and stopped
+// reading/writing) before the token was retained in Agent.Close.
+func (a *Agent) BindResumeToken(token string) bool {
+	if a.ResumeStore == nil || token == "" {
+		return false
+	}
+
+	session, found := a.ResumeStore.Resume(token)
+	if !found {
+		return false
+	}
+
+	session.Rebind(a)
+
+	a.resumeToken = token
+	a.Session = session
+	a.Session.SetState(cherrySession.Working)
+
+	return true
+}
+
+// handshakeRequest/handshakeResponse are the handshake packet's JSON body,
+// kept deliberately tiny: a resume token presented by a reconnecting client,
+// and the (possibly freshly issued) token plus heartbeat interval handed
+// back. net/client.Client builds/parses the exact same shape.
+type handshakeRequest struct {
+	Resume string `json:"resume,omitempty"`
+}
+
+type handshakeResponse struct {
+	Code      int32  `json:"code"`
+	Heartbeat int    `json:"heartbeat"`
+	Resume    string `json:"resume"`
+}
+
+// handleHandshake answers a Handshake packet directly (the way Kick answers
+// out-of-band, bypassing Commands): if the client presents a resume token,
+// BindResumeToken rebinds this agent's Session to the disconnected one before
+// replying; either way the reply carries a resume token via IssueResumeToken
+// so a later reconnect has one to present. This is the only caller of
+// IssueResumeToken/BindResumeToken - without it the resume feature is dead
+// server-side.
+func (a *Agent) handleHandshake(packet cherryFacade.IPacket) {
+	req := &handshakeRequest{}
+	if len(packet.Data()) > 0 {
+		if err := json.Unmarshal(packet.Data(), req); err != nil {
+			cherryLogger.Warnf("[handshake] request unmarshal fail. err = %s", err)
+		}
+	}
+
+	if req.Resume != "" {
+		if a.BindResumeToken(req.Resume) {
+			a.Session.Debugf("[handshake] resumed session. [sid = %s]", a.Session.SID())
+		} else {
+			a.Session.Debugf("[handshake] resume token invalid or expired, issuing a new session.")
+		}
+	}
+
+	rsp := &handshakeResponse{
+		Code:      pomeloHandshakeOK,
+		Heartbeat: int(a.Heartbeat.Seconds()),
+		Resume:    a.IssueResumeToken(),
+	}
+
+	data, err := json.Marshal(rsp)
+	if err != nil {
+		cherryLogger.Warn(err)
+		return
+	}
+
+	pkg, err := a.Codec.Encode(cherryPacket.Handshake, data)
+	if err != nil {
+		cherryLogger.Warn(err)
+		return
+	}
+
+	a.writeRaw(pkg)
+
+	a.SetLastAt()
+}
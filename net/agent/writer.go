@@ -0,0 +1,235 @@
+package cherryAgent
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cherryCode "github.com/cherry-game/cherry/code"
+	cherryLogger "github.com/cherry-game/cherry/logger"
+	cherryMessage "github.com/cherry-game/cherry/net/message"
+	cherryPacket "github.com/cherry-game/cherry/net/packet"
+)
+
+const (
+	DefaultSendQueueSize  = 256             // sendQueue capacity when Options.SendQueueSize is unset
+	DefaultHighWatermark  = 192             // Options.HighWatermark default
+	DefaultLowWatermark   = 64              // Options.LowWatermark default
+	DefaultWatermarkGrace = 3 * time.Second // Options.WatermarkGrace default
+	DefaultFlushInterval  = 20 * time.Millisecond
+)
+
+// IWriterMetrics lets operators watch the send path of a broadcast fan-out
+// (chat, world events) without stalling write(), which runs on a single
+// goroutine per Agent.
+type IWriterMetrics interface {
+	OnQueued(queued int)                      // called after a message is accepted into the queue
+	OnDropped()                               // called when the queue was full and a message was dropped
+	OnFlush(bytes int, latency time.Duration) // called after a batch is written to the conn
+}
+
+// sendQueue is a bounded ring buffer of pendingMessage. It replaces the old
+// fixed WriteBacklog channel: push never evicts a queued message to free a
+// slot, it just reports whether the queue is full. Its caller, Agent.Send,
+// drops a message that does not fit, logging it and reporting it via
+// IWriterMetrics.OnDropped.
+type sendQueue struct {
+	mu       sync.Mutex
+	items    []pendingMessage
+	capacity int
+}
+
+func newSendQueue(capacity int) *sendQueue {
+	return &sendQueue{
+		items:    make([]pendingMessage, 0, capacity),
+		capacity: capacity,
+	}
+}
+
+func (q *sendQueue) push(msg pendingMessage) (queued int, full bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) >= q.capacity {
+		return len(q.items), true
+	}
+
+	q.items = append(q.items, msg)
+	return len(q.items), false
+}
+
+// drain removes and returns all currently queued messages, if any.
+func (q *sendQueue) drain() []pendingMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) == 0 {
+		return nil
+	}
+
+	drained := q.items
+	q.items = make([]pendingMessage, 0, q.capacity)
+	return drained
+}
+
+func (q *sendQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// checkWatermark applies per-session flow control based on the current queue
+// length. Crossing HighWatermark starts a grace-period timer; if the queue is
+// still above HighWatermark once the grace period elapses, the session is
+// kicked with cherryCode.SessionSendOverflow instead of letting messages pile
+// up (or get dropped) forever. Dropping back to LowWatermark resets the timer.
+func (a *Agent) checkWatermark(queued int) {
+	low := a.LowWatermark
+	if low < 1 {
+		low = DefaultLowWatermark
+	}
+
+	if queued <= low {
+		atomic.StoreInt64(&a.highWatermarkSince, 0)
+		return
+	}
+
+	high := a.HighWatermark
+	if high < 1 {
+		high = DefaultHighWatermark
+	}
+
+	if queued < high {
+		return
+	}
+
+	now := time.Now().UnixNano()
+	since := atomic.LoadInt64(&a.highWatermarkSince)
+	if since == 0 {
+		atomic.CompareAndSwapInt64(&a.highWatermarkSince, 0, now)
+		return
+	}
+
+	grace := a.WatermarkGrace
+	if grace < 1 {
+		grace = DefaultWatermarkGrace
+	}
+
+	if time.Duration(now-since) < grace {
+		return
+	}
+
+	a.Session.Warnf("[send] high watermark[%d] exceeded for %s, kicking session.", high, grace)
+	a.Kick(cherryCode.SessionSendOverflow)
+}
+
+// flush marshals and encodes every currently queued pendingMessage and writes
+// them to the conn as a single net.Buffers call, coalescing what used to be
+// one conn.Write per message into at most one syscall per tick.
+func (a *Agent) flush() bool {
+	pending := a.queue.drain()
+	if len(pending) == 0 {
+		return true
+	}
+
+	start := time.Now()
+
+	buffers := make(net.Buffers, 0, len(pending))
+	total := 0
+
+	for i := range pending {
+		data := pending[i]
+
+		payload, err := a.Marshal(data.payload)
+		if err != nil {
+			a.Session.Debugf("message serializer error. data[%s]", data.String())
+			continue
+		}
+
+		m := &cherryMessage.Message{
+			Type:  data.typ,
+			ID:    data.mid,
+			Route: data.route,
+			Data:  payload,
+			Error: data.err,
+		}
+
+		em, err := cherryMessage.Encode(m)
+		if err != nil {
+			cherryLogger.Warn(err)
+			continue
+		}
+
+		p, err := a.Codec.Encode(cherryPacket.Data, em)
+		if err != nil {
+			cherryLogger.Warn(err)
+			continue
+		}
+
+		buffers = append(buffers, p)
+		total += len(p)
+	}
+
+	if len(buffers) == 0 {
+		return true
+	}
+
+	if _, err := buffers.WriteTo(a.conn); err != nil {
+		cherryLogger.Warn(err)
+		return false
+	}
+
+	if a.Metrics != nil {
+		a.Metrics.OnFlush(total, time.Since(start))
+	}
+
+	return true
+}
+
+// DefaultMetrics is a ready-to-use IWriterMetrics backed by atomic counters.
+type DefaultMetrics struct {
+	queued       int64
+	dropped      int64
+	bytesWritten int64
+	flushCount   int64
+	flushNanos   int64
+}
+
+func (m *DefaultMetrics) OnQueued(queued int) {
+	atomic.StoreInt64(&m.queued, int64(queued))
+}
+
+func (m *DefaultMetrics) OnDropped() {
+	atomic.AddInt64(&m.dropped, 1)
+}
+
+func (m *DefaultMetrics) OnFlush(bytes int, latency time.Duration) {
+	atomic.AddInt64(&m.bytesWritten, int64(bytes))
+	atomic.AddInt64(&m.flushCount, 1)
+	atomic.AddInt64(&m.flushNanos, latency.Nanoseconds())
+}
+
+// Queued returns the queue length as of the last accepted Send.
+func (m *DefaultMetrics) Queued() int64 {
+	return atomic.LoadInt64(&m.queued)
+}
+
+// Dropped returns the total number of messages dropped because the queue was full.
+func (m *DefaultMetrics) Dropped() int64 {
+	return atomic.LoadInt64(&m.dropped)
+}
+
+// BytesWritten returns the total bytes flushed to the conn.
+func (m *DefaultMetrics) BytesWritten() int64 {
+	return atomic.LoadInt64(&m.bytesWritten)
+}
+
+// AvgFlushLatency returns the mean latency of a flush call.
+func (m *DefaultMetrics) AvgFlushLatency() time.Duration {
+	count := atomic.LoadInt64(&m.flushCount)
+	if count == 0 {
+		return 0
+	}
+	return time.Duration(atomic.LoadInt64(&m.flushNanos) / count)
+}
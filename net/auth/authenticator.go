@@ -0,0 +1,29 @@
+// Package cherryAuth verifies JWTs presented by clients during login and maps
+// their claims onto a session UID.
+package cherryAuth
+
+import "errors"
+
+// ErrMissingSubject is returned by SubjectAuthenticator when the token has no
+// usable "sub" claim.
+var ErrMissingSubject = errors.New("cherryAuth: jwt has no subject claim")
+
+// IAuthenticator maps a set of verified JWT claims to a session UID. Swap in a
+// custom implementation (e.g. to read a custom claim, or look the subject up
+// in an account table) without touching the auth command itself.
+type IAuthenticator interface {
+	Authenticate(claims map[string]interface{}) (uid string, err error)
+}
+
+// SubjectAuthenticator is the default IAuthenticator: it binds the JWT's "sub"
+// claim as the UID.
+type SubjectAuthenticator struct{}
+
+func (SubjectAuthenticator) Authenticate(claims map[string]interface{}) (string, error) {
+	sub, ok := claims["sub"].(string)
+	if !ok || sub == "" {
+		return "", ErrMissingSubject
+	}
+
+	return sub, nil
+}
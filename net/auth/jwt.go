@@ -0,0 +1,138 @@
+package cherryAuth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// JWTOptions configures a JWTVerifier.
+type JWTOptions struct {
+	Method    string         // signing method name, e.g. "HS256", "RS256"
+	Secret    []byte         // HMAC secret, used when Method is HS256/HS384/HS512
+	PublicKey *rsa.PublicKey // RSA public key, used when Method is RS256/RS384/RS512 and JWKSURL is empty
+	JWKSURL   string         // fetch the RSA public key set from here (by "kid") instead of PublicKey
+	Issuer    string         // required `iss` claim, empty = not enforced
+	Audience  string         // required `aud` claim, empty = not enforced
+}
+
+// JWTVerifier verifies a JWT's signature (HS256/HS384/HS512 or
+// RS256/RS384/RS512) and exp/nbf claims, then checks iss/aud if configured.
+type JWTVerifier struct {
+	opts JWTOptions
+}
+
+func NewJWTVerifier(opts JWTOptions) *JWTVerifier {
+	return &JWTVerifier{opts: opts}
+}
+
+// Verify parses and validates tokenString, returning its claims on success.
+func (v *JWTVerifier) Verify(tokenString string) (map[string]interface{}, error) {
+	token, err := jwt.Parse(tokenString, v.resolveKey)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("cherryAuth: invalid token")
+	}
+
+	if v.opts.Issuer != "" {
+		if !claims.VerifyIssuer(v.opts.Issuer, true) {
+			return nil, fmt.Errorf("cherryAuth: unexpected issuer")
+		}
+	}
+
+	if v.opts.Audience != "" {
+		if !claims.VerifyAudience(v.opts.Audience, true) {
+			return nil, fmt.Errorf("cherryAuth: unexpected audience")
+		}
+	}
+
+	return claims, nil
+}
+
+func (v *JWTVerifier) resolveKey(token *jwt.Token) (interface{}, error) {
+	if token.Method.Alg() != v.opts.Method {
+		return nil, fmt.Errorf("cherryAuth: unexpected signing method %s", token.Method.Alg())
+	}
+
+	switch v.opts.Method {
+	case "HS256", "HS384", "HS512":
+		return v.opts.Secret, nil
+
+	case "RS256", "RS384", "RS512":
+		if v.opts.JWKSURL != "" {
+			kid, _ := token.Header["kid"].(string)
+			return fetchJWKSPublicKey(v.opts.JWKSURL, kid)
+		}
+		return v.opts.PublicKey, nil
+
+	default:
+		return nil, fmt.Errorf("cherryAuth: unsupported signing method %s", v.opts.Method)
+	}
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+// fetchJWKSPublicKey fetches the key set from url and returns the RSA public
+// key matching kid (or the only key present, if kid is empty and there's
+// exactly one). It is fetched fresh on every call; callers expecting
+// high-throughput auth should wrap JWTVerifier with their own cache.
+func fetchJWKSPublicKey(url string, kid string) (*rsa.PublicKey, error) {
+	rsp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+
+	set := &jwkSet{}
+	if err = json.NewDecoder(rsp.Body).Decode(set); err != nil {
+		return nil, err
+	}
+
+	if kid == "" && len(set.Keys) != 1 {
+		return nil, fmt.Errorf("cherryAuth: token has no kid and jwks holds %d keys", len(set.Keys))
+	}
+
+	for _, key := range set.Keys {
+		if kid != "" && key.Kid != kid {
+			continue
+		}
+		return jwkToRSAPublicKey(key)
+	}
+
+	return nil, fmt.Errorf("cherryAuth: no matching jwk found for kid %q", kid)
+}
+
+func jwkToRSAPublicKey(key jwk) (*rsa.PublicKey, error) {
+	nBytes, err := base64.RawURLEncoding.DecodeString(key.N)
+	if err != nil {
+		return nil, fmt.Errorf("cherryAuth: invalid jwk modulus. err = %s", err)
+	}
+
+	eBytes, err := base64.RawURLEncoding.DecodeString(key.E)
+	if err != nil {
+		return nil, fmt.Errorf("cherryAuth: invalid jwk exponent. err = %s", err)
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(nBytes),
+		E: int(new(big.Int).SetBytes(eBytes).Int64()),
+	}, nil
+}
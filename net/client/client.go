@@ -0,0 +1,383 @@
+// Package cherryClient implements a Go client speaking the same
+// handshake/packet/message protocol a cherry server expects, so bots and
+// integration tests can talk to a cluster without a real game client.
+package cherryClient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cherryLogger "github.com/cherry-game/cherry/logger"
+	cherryMessage "github.com/cherry-game/cherry/net/message"
+	cherryPacket "github.com/cherry-game/cherry/net/packet"
+)
+
+const (
+	DefaultRequestTimeout = 10 * time.Second
+	DefaultReconnectDelay = 2 * time.Second
+	DefaultHeartbeat      = 30 * time.Second
+)
+
+var (
+	ErrNotConnected = errors.New("cherryClient: not connected")
+	ErrClosed       = errors.New("cherryClient: client closed")
+)
+
+type (
+	// ISerializer is the payload serializer (e.g. json, protobuf). It only
+	// (de)serializes message data, not the handshake body itself, which is
+	// always plain JSON like the server. It is not negotiated: the handshake
+	// does not carry its Name(), so it has to match the server's serializer.
+	ISerializer interface {
+		Name() string
+		Marshal(v interface{}) ([]byte, error)
+		Unmarshal(data []byte, v interface{}) error
+	}
+
+	// PushHandler is invoked for every push received on a subscribed route.
+	PushHandler func(route string, data []byte)
+
+	// Options configures a Client.
+	Options struct {
+		Address        string        // host:port to dial
+		Serializer     ISerializer   // must match the server's serializer (not negotiated), defaults to jsonSerializer
+		RequestTimeout time.Duration // per-request deadline, defaults to DefaultRequestTimeout
+		AutoReconnect  bool          // reconnect (and resume) on unexpected disconnect
+		ReconnectDelay time.Duration // delay between reconnect attempts, defaults to DefaultReconnectDelay
+	}
+
+	// handshakeRequest/handshakeResponse mirror cherryAgent's handshake
+	// packet body exactly (net/agent/resume.go) - the wire format a real
+	// cherry node actually answers, not a negotiated/invented one. Payload
+	// serialization (Options.Serializer) is a separate, out-of-band setting
+	// that must already match the server's configured serializer; it isn't
+	// part of the handshake itself.
+	handshakeRequest struct {
+		Resume string `json:"resume,omitempty"`
+	}
+
+	handshakeResponse struct {
+		Code      int32  `json:"code"`
+		Heartbeat int    `json:"heartbeat"` // seconds
+		Resume    string `json:"resume"`    // resume token to present on reconnect
+	}
+
+	pendingRequest struct {
+		rsp chan *cherryMessage.Message
+	}
+
+	// Client is a reconnecting, resumable client for a cherry node. Create one
+	// with New, then call Connect. Safe for concurrent use.
+	Client struct {
+		opts Options
+
+		mu          sync.Mutex
+		conn        net.Conn
+		nextMid     uint32
+		pending     map[uint]*pendingRequest
+		pushHandler map[string]PushHandler
+		resumeToken string
+		heartbeat   time.Duration
+		closed      int32
+		chDie       chan struct{}
+		writeMu     sync.Mutex // serializes writePacket's head+body writes against Request/Notify/heartbeatLoop
+	}
+)
+
+// New creates a Client. Call Connect to open the connection.
+func New(opts Options) *Client {
+	if opts.RequestTimeout < 1 {
+		opts.RequestTimeout = DefaultRequestTimeout
+	}
+	if opts.ReconnectDelay < 1 {
+		opts.ReconnectDelay = DefaultReconnectDelay
+	}
+	if opts.Serializer == nil {
+		opts.Serializer = jsonSerializer{}
+	}
+
+	return &Client{
+		opts:        opts,
+		pending:     make(map[uint]*pendingRequest),
+		pushHandler: make(map[string]PushHandler),
+		chDie:       make(chan struct{}),
+	}
+}
+
+// writePacket serializes a packet write against every other writer (Request,
+// Notify, heartbeatLoop, the handshake itself) behind writeMu: writePacket
+// does two separate conn.Write calls (head, then body), and without a single
+// writer or mutex a heartbeat firing mid-request can interleave bytes and
+// corrupt the length-prefixed framing.
+func (c *Client) writePacket(conn net.Conn, typ cherryPacket.Type, body []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	return writePacket(conn, typ, body)
+}
+
+// OnPush registers a callback for push messages received on route. Only one
+// handler may be registered per route; a later call replaces an earlier one.
+func (c *Client) OnPush(route string, handler PushHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pushHandler[route] = handler
+}
+
+// Connect dials the server, performs the handshake (presenting any resume
+// token from a previous session) and starts the read/heartbeat loops.
+func (c *Client) Connect() error {
+	conn, err := net.Dial("tcp", c.opts.Address)
+	if err != nil {
+		return err
+	}
+
+	if err = c.handshake(conn); err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	c.mu.Lock()
+	c.conn = conn
+	c.mu.Unlock()
+
+	go c.readLoop(conn)
+	go c.heartbeatLoop(conn)
+
+	return nil
+}
+
+func (c *Client) handshake(conn net.Conn) error {
+	req := handshakeRequest{
+		Resume: c.resumeToken,
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	if err = c.writePacket(conn, cherryPacket.Handshake, body); err != nil {
+		return err
+	}
+
+	typ, data, err := readPacket(conn)
+	if err != nil {
+		return err
+	}
+
+	if typ != cherryPacket.Handshake {
+		return fmt.Errorf("cherryClient: unexpected packet type on handshake. type = %d", typ)
+	}
+
+	rsp := &handshakeResponse{}
+	if err = json.Unmarshal(data, rsp); err != nil {
+		return err
+	}
+
+	c.resumeToken = rsp.Resume
+	c.heartbeat = time.Duration(rsp.Heartbeat) * time.Second
+	if c.heartbeat < 1 {
+		c.heartbeat = DefaultHeartbeat
+	}
+
+	// complete the 3-way handshake; the server treats this as a no-op ack
+	return c.writePacket(conn, cherryPacket.HandshakeAck, nil)
+}
+
+func (c *Client) heartbeatLoop(conn net.Conn) {
+	ticker := time.NewTicker(c.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.chDie:
+			return
+		case <-ticker.C:
+			if err := c.writePacket(conn, cherryPacket.Heartbeat, nil); err != nil {
+				cherryLogger.Warnf("[cherryClient] heartbeat write fail. err = %s", err)
+				c.handleDisconnect(conn)
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) readLoop(conn net.Conn) {
+	for {
+		typ, data, err := readPacket(conn)
+		if err != nil {
+			c.handleDisconnect(conn)
+			return
+		}
+
+		switch typ {
+		case cherryPacket.Kick:
+			c.handleDisconnect(conn)
+			return
+		case cherryPacket.Data:
+			c.handleMessage(data)
+		}
+	}
+}
+
+func (c *Client) handleMessage(data []byte) {
+	m, err := cherryMessage.Decode(data)
+	if err != nil {
+		cherryLogger.Warnf("[cherryClient] message decode fail. err = %s", err)
+		return
+	}
+
+	switch m.Type {
+	case cherryMessage.Response:
+		c.mu.Lock()
+		req, found := c.pending[m.ID]
+		if found {
+			delete(c.pending, m.ID)
+		}
+		c.mu.Unlock()
+
+		if found {
+			req.rsp <- m
+		}
+
+	case cherryMessage.Push:
+		c.mu.Lock()
+		handler, found := c.pushHandler[m.Route]
+		c.mu.Unlock()
+
+		if found {
+			handler(m.Route, m.Data)
+		}
+	}
+}
+
+// Request sends a request to route and blocks until the matching response
+// arrives or Options.RequestTimeout elapses.
+func (c *Client) Request(route string, val interface{}) (*cherryMessage.Message, error) {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+
+	if conn == nil {
+		return nil, ErrNotConnected
+	}
+
+	payload, err := c.opts.Serializer.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+
+	mid := uint(atomic.AddUint32(&c.nextMid, 1))
+
+	req := &pendingRequest{rsp: make(chan *cherryMessage.Message, 1)}
+
+	c.mu.Lock()
+	c.pending[mid] = req
+	c.mu.Unlock()
+
+	em, err := cherryMessage.Encode(&cherryMessage.Message{
+		Type:  cherryMessage.Request,
+		ID:    mid,
+		Route: route,
+		Data:  payload,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = c.writePacket(conn, cherryPacket.Data, em); err != nil {
+		return nil, err
+	}
+
+	select {
+	case rsp := <-req.rsp:
+		return rsp, nil
+	case <-time.After(c.opts.RequestTimeout):
+		c.mu.Lock()
+		delete(c.pending, mid)
+		c.mu.Unlock()
+		return nil, fmt.Errorf("cherryClient: request timeout. route = %s", route)
+	}
+}
+
+// Notify sends a route/payload without waiting for a response.
+func (c *Client) Notify(route string, val interface{}) error {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+
+	if conn == nil {
+		return ErrNotConnected
+	}
+
+	payload, err := c.opts.Serializer.Marshal(val)
+	if err != nil {
+		return err
+	}
+
+	em, err := cherryMessage.Encode(&cherryMessage.Message{
+		Type:  cherryMessage.Notify,
+		Route: route,
+		Data:  payload,
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.writePacket(conn, cherryPacket.Data, em)
+}
+
+func (c *Client) handleDisconnect(conn net.Conn) {
+	c.mu.Lock()
+	if c.conn == conn {
+		c.conn = nil
+	}
+	c.mu.Unlock()
+
+	_ = conn.Close()
+
+	if atomic.LoadInt32(&c.closed) == 1 {
+		return
+	}
+
+	if !c.opts.AutoReconnect {
+		return
+	}
+
+	go c.reconnectLoop()
+}
+
+func (c *Client) reconnectLoop() {
+	for atomic.LoadInt32(&c.closed) == 0 {
+		if err := c.Connect(); err == nil {
+			cherryLogger.Infof("[cherryClient] reconnected and resumed session.")
+			return
+		}
+
+		time.Sleep(c.opts.ReconnectDelay)
+	}
+}
+
+// Close closes the connection and stops reconnecting.
+func (c *Client) Close() {
+	if !atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		return
+	}
+
+	close(c.chDie)
+
+	c.mu.Lock()
+	conn := c.conn
+	c.conn = nil
+	c.mu.Unlock()
+
+	if conn != nil {
+		_ = conn.Close()
+	}
+}
@@ -0,0 +1,69 @@
+package cherryClient
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+
+	cherryPacket "github.com/cherry-game/cherry/net/packet"
+)
+
+// packetHeadLength is pomelo's fixed packet header: 1 byte type + 3 byte
+// big-endian body length.
+const packetHeadLength = 4
+
+func writePacket(conn net.Conn, typ cherryPacket.Type, body []byte) error {
+	head := [packetHeadLength]byte{
+		byte(typ),
+		byte(len(body) >> 16),
+		byte(len(body) >> 8),
+		byte(len(body)),
+	}
+
+	if _, err := conn.Write(head[:]); err != nil {
+		return err
+	}
+
+	if len(body) == 0 {
+		return nil
+	}
+
+	_, err := conn.Write(body)
+	return err
+}
+
+func readPacket(conn net.Conn) (cherryPacket.Type, []byte, error) {
+	head := make([]byte, packetHeadLength)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return 0, nil, err
+	}
+
+	typ := cherryPacket.Type(head[0])
+	length := int(head[1])<<16 | int(head[2])<<8 | int(head[3])
+
+	if length == 0 {
+		return typ, nil, nil
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return 0, nil, err
+	}
+
+	return typ, body, nil
+}
+
+// jsonSerializer is the default Options.Serializer.
+type jsonSerializer struct{}
+
+func (jsonSerializer) Name() string {
+	return "json"
+}
+
+func (jsonSerializer) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonSerializer) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,105 @@
+package cherryCommand
+
+import (
+	"encoding/json"
+
+	cherryCode "github.com/cherry-game/cherry/code"
+	cherryFacade "github.com/cherry-game/cherry/facade"
+	clog "github.com/cherry-game/cherry/logger"
+	cherryAuth "github.com/cherry-game/cherry/net/auth"
+	cherryMessage "github.com/cherry-game/cherry/net/message"
+	cherryProto "github.com/cherry-game/cherry/net/proto"
+	cherrySession "github.com/cherry-game/cherry/net/session"
+)
+
+// DefaultAuthRoute is the well-known route a client calls to authenticate,
+// e.g. {"route":"sys.auth","data":{"token":"..."}}
+const DefaultAuthRoute = "sys.auth"
+
+type authRequest struct {
+	Token string `json:"token"`
+}
+
+// AuthCommand wraps the regular Data command (Next), verifying a JWT
+// presented on Route and binding the resulting subject claim as the session
+// UID via cherrySession, replacing the ad-hoc RegisterDevAccount/GetUID flow.
+// Every other route is gated until the session is bound, replying
+// cherryCode.SessionUIDNotBind, giving operators a standard way to plug an
+// identity provider into the gate without writing custom handlers.
+type AuthCommand struct {
+	Route         string                    // message route this command answers to, defaults to DefaultAuthRoute
+	Verifier      *cherryAuth.JWTVerifier   // token signature/exp/nbf/iss/aud verification
+	Authenticator cherryAuth.IAuthenticator // claims -> UID, defaults to cherryAuth.SubjectAuthenticator{}
+	Next          ICommand                  // the regular Data command, invoked once the session is authenticated
+}
+
+// NewAuthCommand builds an AuthCommand for DefaultAuthRoute, wrapping next.
+func NewAuthCommand(next ICommand, verifier *cherryAuth.JWTVerifier, authenticator cherryAuth.IAuthenticator) *AuthCommand {
+	if authenticator == nil {
+		authenticator = cherryAuth.SubjectAuthenticator{}
+	}
+
+	return &AuthCommand{
+		Route:         DefaultAuthRoute,
+		Verifier:      verifier,
+		Authenticator: authenticator,
+		Next:          next,
+	}
+}
+
+func (c *AuthCommand) Do(session *cherrySession.Session, packet cherryFacade.IPacket) {
+	m, err := cherryMessage.Decode(packet.Data())
+	if err != nil {
+		clog.Warnf("[AuthCommand] message decode fail. err = %s", err)
+		return
+	}
+
+	if m.Route == c.Route {
+		c.authenticate(session, m)
+		return
+	}
+
+	if session.UID() == "" {
+		clog.Debugf("[AuthCommand] route blocked, session not authenticated. [route = %s]", m.Route)
+		respond(session, m.ID, cherryCode.SessionUIDNotBind)
+		return
+	}
+
+	if c.Next != nil {
+		c.Next.Do(session, packet)
+	}
+}
+
+func (c *AuthCommand) authenticate(session *cherrySession.Session, m *cherryMessage.Message) {
+	req := &authRequest{}
+	if err := json.Unmarshal(m.Data, req); err != nil {
+		clog.Warnf("[AuthCommand] request unmarshal fail. err = %s", err)
+		respond(session, m.ID, cherryCode.RPCUnmarshalError)
+		return
+	}
+
+	claims, err := c.Verifier.Verify(req.Token)
+	if err != nil {
+		clog.Warnf("[AuthCommand] token verify fail. err = %s", err)
+		respond(session, m.ID, cherryCode.SessionUIDNotBind)
+		return
+	}
+
+	uid, err := c.Authenticator.Authenticate(claims)
+	if err != nil {
+		clog.Warnf("[AuthCommand] authenticate fail. err = %s", err)
+		respond(session, m.ID, cherryCode.SessionUIDNotBind)
+		return
+	}
+
+	session.Bind(uid)
+	respond(session, m.ID, cherryCode.OK)
+}
+
+// respond wraps code in a cherryProto.Response payload and forwards it to
+// cherrySession.Session.Response, whose third argument is a variadic isError
+// bool (it mirrors Agent.Response's signature), not a positional response
+// code; isError is set for every non-OK code.
+func respond(session *cherrySession.Session, mid uint, code int32) {
+	session.Response(mid, &cherryProto.Response{Code: code}, code != cherryCode.OK)
+}
@@ -0,0 +1,23 @@
+package cherryDiscovery
+
+import (
+	"fmt"
+
+	cfacade "github.com/cherry-game/cherry/facade"
+)
+
+// New builds the IDiscovery driver selected by mode (the cluster.discovery_mode
+// config value), so application bootstrap can do
+// discovery, err := cherryDiscovery.New(cprofile.GetConfig("cluster").GetString("discovery_mode"))
+// and, once err is nil, app.SetDiscovery(discovery)
+// instead of hard-coding which driver struct to construct.
+func New(mode string) (cfacade.IDiscovery, error) {
+	switch mode {
+	case "", "nats":
+		return &DiscoveryNATS{}, nil
+	case "etcd":
+		return &DiscoveryEtcd{}, nil
+	default:
+		return nil, fmt.Errorf("cherryDiscovery: unknown discovery_mode %q", mode)
+	}
+}
@@ -0,0 +1,272 @@
+package cherryDiscovery
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"time"
+
+	cfacade "github.com/cherry-game/cherry/facade"
+	clog "github.com/cherry-game/cherry/logger"
+	cproto "github.com/cherry-game/cherry/net/proto"
+	cprofile "github.com/cherry-game/cherry/profile"
+	"go.etcd.io/etcd/client/pkg/v3/transport"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// DiscoveryEtcd etcd去中心化成员发现实现
+// 每个节点以带TTL的租约(lease)注册一个key: <prefix>/<nodeType>/<nodeId> -> cproto.Member
+// 启动时通过Get(prefix, WithPrefix)获取当前成员列表，再通过Watch(prefix, WithPrefix)持续接收变更
+// PUT -> AddMember, DELETE(含租约到期) -> RemoveMember
+// 租约丢失时重新注册，watch遇到ErrCompacted时重新list后从最新revision继续watch
+type DiscoveryEtcd struct {
+	DiscoveryDefault
+	app      cfacade.IApplication
+	client   *clientv3.Client
+	leaseID  clientv3.LeaseID
+	prefix   string
+	selfKey  string
+	ttl      int64
+	stopChan chan struct{}
+}
+
+func (m *DiscoveryEtcd) Name() string {
+	return "etcd"
+}
+
+func (m *DiscoveryEtcd) Load(app cfacade.IApplication) {
+	m.app = app
+	m.stopChan = make(chan struct{})
+
+	config := cprofile.GetConfig("cluster").GetConfig(m.Name())
+	if config.LastError() != nil {
+		clog.Fatalf("etcd config parameter not found. err = %v", config.LastError())
+	}
+
+	endpoints := strings.Split(config.GetString("endpoints"), ",")
+	if len(endpoints) < 1 || endpoints[0] == "" {
+		clog.Fatal("etcd endpoints not in config.")
+	}
+
+	m.prefix = config.GetString("prefix")
+	if m.prefix == "" {
+		m.prefix = "/cherry/members"
+	}
+
+	m.ttl = config.GetInt64("lease_ttl")
+	if m.ttl < 1 {
+		m.ttl = 10
+	}
+
+	var tlsConfig *tls.Config
+	var err error
+	if tlsCfg := config.GetConfig("tls"); tlsCfg.LastError() == nil {
+		certFile := tlsCfg.GetString("cert_file")
+		keyFile := tlsCfg.GetString("key_file")
+		caFile := tlsCfg.GetString("ca_file")
+
+		if certFile != "" || keyFile != "" || caFile != "" {
+			info := transport.TLSInfo{
+				CertFile:      certFile,
+				KeyFile:       keyFile,
+				TrustedCAFile: caFile,
+			}
+
+			tlsConfig, err = info.ClientConfig()
+			if err != nil {
+				clog.Fatalf("etcd tls config error. err = %v", err)
+			}
+		}
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: 5 * time.Second,
+		TLS:         tlsConfig,
+	})
+	if err != nil {
+		clog.Fatalf("etcd connect fail. err = %v", err)
+	}
+
+	m.client = client
+	m.selfKey = fmt.Sprintf("%s/%s/%s", m.prefix, app.NodeType(), app.NodeId())
+
+	rev := m.list()
+	m.register()
+
+	go m.watch(rev)
+
+	clog.Infof("[discovery = %s] is running. [endpoints = %v] [prefix = %s]", m.Name(), endpoints, m.prefix)
+}
+
+// list 启动时(或watch遇到压缩错误后)全量拉取前缀下所有成员，返回该次Get的
+// revision，供watch从rev+1继续，避免Get和Watch建立之间的变更丢失
+func (m *DiscoveryEtcd) list() int64 {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rsp, err := m.client.Get(ctx, m.prefix, clientv3.WithPrefix())
+	if err != nil {
+		clog.Warnf("[etcd] list members fail. err = %s", err)
+		return 0
+	}
+
+	for _, kv := range rsp.Kvs {
+		member := &cproto.Member{}
+		if err = m.app.Serializer().Unmarshal(kv.Value, member); err != nil {
+			clog.Warnf("[etcd] member unmarshal fail. key = %s, err = %s", kv.Key, err)
+			continue
+		}
+
+		if member.GetNodeId() == m.app.NodeId() {
+			continue
+		}
+
+		m.AddMember(member)
+	}
+
+	if rsp.Header == nil {
+		return 0
+	}
+
+	return rsp.Header.Revision
+}
+
+// register 创建租约并注册自身节点，租约到期前自动续约，丢失后重新注册
+func (m *DiscoveryEtcd) register() {
+	self := &cproto.Member{
+		NodeId:   m.app.NodeId(),
+		NodeType: m.app.NodeType(),
+		Address:  m.app.RpcAddress(),
+		Settings: make(map[string]string),
+	}
+
+	data, err := m.app.Serializer().Marshal(self)
+	if err != nil {
+		clog.Fatalf("[etcd] marshal self member fail. err = %s", err)
+	}
+
+	lease, err := m.client.Grant(context.Background(), m.ttl)
+	if err != nil {
+		clog.Fatalf("[etcd] lease grant fail. err = %s", err)
+	}
+
+	m.leaseID = lease.ID
+
+	_, err = m.client.Put(context.Background(), m.selfKey, string(data), clientv3.WithLease(m.leaseID))
+	if err != nil {
+		clog.Fatalf("[etcd] register self member fail. err = %s", err)
+	}
+
+	keepAliveChan, err := m.client.KeepAlive(context.Background(), m.leaseID)
+	if err != nil {
+		clog.Fatalf("[etcd] lease keepalive fail. err = %s", err)
+	}
+
+	go m.keepAlive(keepAliveChan)
+}
+
+// keepAlive 消费keepalive应答，租约丢失(channel关闭)后重新register
+func (m *DiscoveryEtcd) keepAlive(ch <-chan *clientv3.LeaseKeepAliveResponse) {
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case _, ok := <-ch:
+			if ok {
+				continue
+			}
+
+			clog.Warnf("[etcd] lease lost. [nodeId = %s] re-register.", m.app.NodeId())
+			m.register()
+			return
+		}
+	}
+}
+
+// watch 持续监听成员前缀变化，从list()返回的revision+1开始，确保Get和Watch
+// 建立之间发生的变更不会丢失；遇到压缩错误时重新list后从最新revision恢复watch
+func (m *DiscoveryEtcd) watch(startRev int64) {
+	watchChan := m.client.Watch(context.Background(), m.prefix, watchOpts(startRev)...)
+
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case rsp, ok := <-watchChan:
+			if !ok {
+				return
+			}
+
+			if err := rsp.Err(); err != nil {
+				clog.Warnf("[etcd] watch error. err = %s, re-list and resume.", err)
+				rev := m.list()
+				watchChan = m.client.Watch(context.Background(), m.prefix, watchOpts(rev)...)
+				continue
+			}
+
+			for _, event := range rsp.Events {
+				m.handleEvent(event)
+			}
+		}
+	}
+}
+
+func watchOpts(rev int64) []clientv3.OpOption {
+	opts := []clientv3.OpOption{clientv3.WithPrefix()}
+	if rev > 0 {
+		opts = append(opts, clientv3.WithRev(rev+1))
+	}
+	return opts
+}
+
+func (m *DiscoveryEtcd) handleEvent(event *clientv3.Event) {
+	switch event.Type {
+	case clientv3.EventTypePut:
+		member := &cproto.Member{}
+		if err := m.app.Serializer().Unmarshal(event.Kv.Value, member); err != nil {
+			clog.Warnf("[etcd] member unmarshal fail. key = %s, err = %s", event.Kv.Key, err)
+			return
+		}
+
+		if member.GetNodeId() == m.app.NodeId() {
+			return
+		}
+
+		m.AddMember(member)
+
+	case clientv3.EventTypeDelete:
+		nodeId := nodeIdFromKey(string(event.Kv.Key))
+		if nodeId == "" || nodeId == m.app.NodeId() {
+			return
+		}
+
+		m.RemoveMember(nodeId)
+	}
+}
+
+func nodeIdFromKey(key string) string {
+	idx := strings.LastIndex(key, "/")
+	if idx < 0 {
+		return ""
+	}
+	return key[idx+1:]
+}
+
+func (m *DiscoveryEtcd) Stop() {
+	close(m.stopChan)
+
+	_, err := m.client.Delete(context.Background(), m.selfKey)
+	if err != nil {
+		clog.Warnf("[etcd] unregister self member fail. err = %s", err)
+	}
+
+	if m.leaseID != 0 {
+		_, _ = m.client.Revoke(context.Background(), m.leaseID)
+	}
+
+	if err = m.client.Close(); err != nil {
+		clog.Warnf("[etcd] close client fail. err = %s", err)
+	}
+}